@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+
+	libvirt "libvirt.org/go/libvirt"
+)
+
+// Options bundles the per-VM settings shared across a batch run.
+type Options struct {
+	Prefix       string
+	StartIndex   int
+	RuleName     string
+	Scheme       string
+	Allocation   string
+	DryRun       bool
+	Verbose      bool
+	ShowContent  bool
+	Import       bool
+	SyncMetadata bool
+	OutputFormat string
+	SeedISO      string
+	MultiVM      bool
+}
+
+// VMResult is the outcome of processing a single VM, used to build the
+// end-of-run summary table.
+type VMResult struct {
+	Name      string
+	NumIfaces int
+	Status    string
+	Err       error
+}
+
+// listShutoffDomains returns the names of every currently shut-off domain
+// known to conn, optionally filtered by a compiled name regex.
+func listShutoffDomains(conn *libvirt.Connect, match *regexp.Regexp) ([]string, error) {
+	doms, err := conn.ListAllDomains(libvirt.CONNECT_LIST_DOMAINS_SHUTOFF)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list shut-off domains: %v", err)
+	}
+
+	names := make([]string, 0, len(doms))
+	for _, dom := range doms {
+		name, err := dom.GetName()
+		dom.Free()
+		if err != nil {
+			continue
+		}
+		if match == nil || match.MatchString(name) {
+			names = append(names, name)
+		}
+	}
+
+	return names, nil
+}
+
+// batchJob pairs a VM name with its slot in the results slice, so workers
+// never need to re-derive the slot by matching names (which breaks if a
+// name appears more than once).
+type batchJob struct {
+	idx    int
+	vmName string
+}
+
+// runBatch processes vmNames concurrently, bounded by parallelism workers,
+// and returns one VMResult per VM.
+func runBatch(conn *libvirt.Connect, vmNames []string, parallelism int, opts Options) []VMResult {
+	return runBatchWith(vmNames, parallelism, func(vmName string) VMResult {
+		return processVM(conn, vmName, opts)
+	})
+}
+
+// runBatchWith drives the worker pool over vmNames, invoking process for
+// each one. Split out from runBatch so the scheduling/result-indexing
+// logic can be unit tested without a live libvirt connection.
+func runBatchWith(vmNames []string, parallelism int, process func(vmName string) VMResult) []VMResult {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+
+	jobs := make(chan batchJob)
+	results := make([]VMResult, len(vmNames))
+
+	var wg sync.WaitGroup
+	for w := 0; w < parallelism; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				results[job.idx] = process(job.vmName)
+			}
+		}()
+	}
+
+	for i, vmName := range vmNames {
+		jobs <- batchJob{idx: i, vmName: vmName}
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
+
+// printSummary renders the VM / #ifaces / status / error table after a
+// batch run.
+func printSummary(results []VMResult) {
+	fmt.Println()
+	fmt.Println("Summary:")
+	fmt.Printf("%-24s %-8s %-10s %s\n", "VM", "#IFACES", "STATUS", "ERROR")
+	for _, r := range results {
+		status := r.Status
+		errMsg := ""
+		if r.Err != nil {
+			errMsg = r.Err.Error()
+		}
+		fmt.Printf("%-24s %-8d %-10s %s\n", r.Name, r.NumIfaces, status, errMsg)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRunBatchWithPreservesOrderAndDuplicates(t *testing.T) {
+	vmNames := []string{"vm1", "vm2", "vm1"}
+
+	var calls int32
+	results := runBatchWith(vmNames, 4, func(vmName string) VMResult {
+		n := atomic.AddInt32(&calls, 1)
+		return VMResult{Name: vmName, NumIfaces: int(n)}
+	})
+
+	if int(calls) != len(vmNames) {
+		t.Fatalf("expected %d calls, got %d", len(vmNames), calls)
+	}
+	if len(results) != len(vmNames) {
+		t.Fatalf("expected %d results, got %d", len(vmNames), len(results))
+	}
+
+	for i, r := range results {
+		if r.Name != vmNames[i] {
+			t.Errorf("result %d: expected name %q, got %q", i, vmNames[i], r.Name)
+		}
+		if r.NumIfaces == 0 {
+			t.Errorf("result %d (%q) was never populated (zero-value VMResult)", i, r.Name)
+		}
+	}
+}
+
+func TestRunBatchWithSingleWorker(t *testing.T) {
+	vmNames := []string{"a", "b", "c"}
+
+	results := runBatchWith(vmNames, 1, func(vmName string) VMResult {
+		return VMResult{Name: vmName, Status: "ok"}
+	})
+
+	for i, r := range results {
+		if r.Status != "ok" {
+			t.Errorf("result %d (%q): expected status ok, got %q", i, vmNames[i], r.Status)
+		}
+	}
+}
+
+func TestRunBatchWithErrorPropagates(t *testing.T) {
+	vmNames := []string{"broken"}
+
+	results := runBatchWith(vmNames, 1, func(vmName string) VMResult {
+		return VMResult{Name: vmName, Status: "error", Err: fmt.Errorf("boom")}
+	})
+
+	if results[0].Err == nil || results[0].Err.Error() != "boom" {
+		t.Errorf("expected error 'boom', got %v", results[0].Err)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	libvirt "libvirt.org/go/libvirt"
+)
+
+// seedISOPath resolves the ISO path to use for vmName. When processing a
+// single VM, base is used verbatim. When processing more than one VM
+// (--all/--match, or several names on the command line), every VM needs
+// its own file, so base must instead name an existing directory and the
+// per-VM ISO is written inside it.
+func seedISOPath(base, vmName string, multiVM bool) (string, error) {
+	if !multiVM {
+		return base, nil
+	}
+
+	info, err := os.Stat(base)
+	if err != nil || !info.IsDir() {
+		return "", fmt.Errorf("--seed-iso must name an existing directory when processing more than one VM (got '%s')", base)
+	}
+
+	return filepath.Join(base, vmName+"-seed.iso"), nil
+}
+
+// processCloudInitV2 handles the cloud-init-v2 output format, which does
+// not write files into the guest's existing filesystem: instead it builds
+// a NoCloud seed ISO carrying a network-config document and attaches it
+// to the domain.
+func processCloudInitV2(dom *libvirt.Domain, vmName string, macAddresses []string, names map[string]string, state *VMState, opts Options) VMResult {
+	result := VMResult{Name: vmName, NumIfaces: len(macAddresses)}
+
+	if opts.SeedISO == "" {
+		result.Status = "error"
+		result.Err = fmt.Errorf("--output-format cloud-init-v2 requires --seed-iso <path>")
+		return result
+	}
+
+	isoPath, err := seedISOPath(opts.SeedISO, vmName, opts.MultiVM)
+	if err != nil {
+		result.Status = "error"
+		result.Err = err
+		return result
+	}
+
+	ordered := sortedMacs(macAddresses, names, opts.Prefix)
+	networkConfig := cloudInitNetworkConfigYAML(ordered, names)
+
+	if opts.ShowContent {
+		fmt.Println("Generated network-config:")
+		fmt.Println("----------------------------------------")
+		fmt.Println(networkConfig)
+		fmt.Println("----------------------------------------")
+	}
+
+	if opts.DryRun {
+		result.Status = "dry-run"
+		return result
+	}
+
+	if err := buildSeedISO(vmName, isoPath, networkConfig); err != nil {
+		result.Status = "error"
+		result.Err = err
+		return result
+	}
+
+	if err := attachSeedISO(dom, isoPath); err != nil {
+		result.Status = "error"
+		result.Err = fmt.Errorf("Failed to attach seed ISO: %v", err)
+		return result
+	}
+
+	if err := saveState(state); err != nil {
+		result.Status = "error"
+		result.Err = fmt.Errorf("Failed to save MAC/name mapping: %v", err)
+		return result
+	}
+
+	if opts.SyncMetadata {
+		if err := syncStateToMetadata(dom, state); err != nil {
+			result.Status = "error"
+			result.Err = fmt.Errorf("Failed to sync mapping into domain metadata: %v", err)
+			return result
+		}
+	}
+
+	result.Status = "ok"
+	return result
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+var udevRuleLine = regexp.MustCompile(`ATTR\{address\}==\"([0-9a-fA-F:]+)\".*NAME=\"([^\"]+)\"`)
+
+// importFromGuestRules reads the guest's existing udev rules file via
+// virt-cat and merges any MAC -> name assignments it finds into state,
+// returning how many entries were learned.
+func importFromGuestRules(vmName, ruleName string, state *VMState) (int, error) {
+	cmd := exec.Command("virt-cat", "-d", vmName, "/etc/udev/rules.d/"+ruleName)
+	output, err := cmd.Output()
+	if err != nil {
+		return 0, fmt.Errorf("Failed to read /etc/udev/rules.d/%s from VM: %v", ruleName, err)
+	}
+
+	return mergeUdevRules(string(output), state), nil
+}
+
+// mergeUdevRules scans udev rules text for ATTR{address}=="mac" NAME="name"
+// assignments and merges any MACs not already present into state, without
+// overwriting existing mappings. It returns how many entries were learned.
+func mergeUdevRules(rulesText string, state *VMState) int {
+	learned := 0
+	scanner := bufio.NewScanner(strings.NewReader(rulesText))
+	for scanner.Scan() {
+		matches := udevRuleLine.FindStringSubmatch(scanner.Text())
+		if matches == nil {
+			continue
+		}
+		mac, name := matches[1], matches[2]
+		if _, ok := state.Mappings[mac]; !ok {
+			state.Mappings[mac] = name
+			learned++
+		}
+	}
+
+	return learned
+}
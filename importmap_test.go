@@ -0,0 +1,51 @@
+package main
+
+import "testing"
+
+func TestUdevRuleLineMatches(t *testing.T) {
+	line := `SUBSYSTEM=="net", ACTION=="add", ATTR{address}=="aa:bb:cc:dd:ee:01", NAME="eth0"`
+
+	matches := udevRuleLine.FindStringSubmatch(line)
+	if matches == nil {
+		t.Fatalf("expected rule line to match, got no match")
+	}
+	if matches[1] != "aa:bb:cc:dd:ee:01" {
+		t.Errorf("expected MAC 'aa:bb:cc:dd:ee:01', got %q", matches[1])
+	}
+	if matches[2] != "eth0" {
+		t.Errorf("expected NAME 'eth0', got %q", matches[2])
+	}
+}
+
+func TestUdevRuleLineIgnoresComments(t *testing.T) {
+	line := "# Network interface persistence rules for VM 'vm1'"
+
+	if udevRuleLine.FindStringSubmatch(line) != nil {
+		t.Errorf("expected comment line not to match")
+	}
+}
+
+func TestImportFromGuestRulesMergesWithoutOverwriting(t *testing.T) {
+	state := &VMState{
+		VMName: "vm1",
+		Mappings: map[string]string{
+			"aa:bb:cc:dd:ee:01": "eth5",
+		},
+	}
+
+	rules := `# Network interface persistence rules for VM 'vm1'
+SUBSYSTEM=="net", ACTION=="add", ATTR{address}=="aa:bb:cc:dd:ee:01", NAME="eth0"
+SUBSYSTEM=="net", ACTION=="add", ATTR{address}=="aa:bb:cc:dd:ee:02", NAME="eth1"
+`
+	learned := mergeUdevRules(rules, state)
+
+	if learned != 1 {
+		t.Errorf("expected 1 newly learned mapping, got %d", learned)
+	}
+	if state.Mappings["aa:bb:cc:dd:ee:01"] != "eth5" {
+		t.Errorf("expected existing mapping to be preserved, got %s", state.Mappings["aa:bb:cc:dd:ee:01"])
+	}
+	if state.Mappings["aa:bb:cc:dd:ee:02"] != "eth1" {
+		t.Errorf("expected new mapping to be learned, got %s", state.Mappings["aa:bb:cc:dd:ee:02"])
+	}
+}
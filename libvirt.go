@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+
+	libvirt "libvirt.org/go/libvirt"
+	libvirtxml "libvirt.org/go/libvirtxml"
+)
+
+// checkVMStatus verifies that dom is shut off, returning an error describing
+// why it is not usable otherwise (running, paused, etc).
+func checkVMStatus(dom *libvirt.Domain, vmName string) error {
+	state, _, err := dom.GetState()
+	if err != nil {
+		return fmt.Errorf("Failed to get state for VM '%s': %v", vmName, err)
+	}
+
+	if state == libvirt.DOMAIN_SHUTOFF {
+		return nil
+	}
+
+	desc := "running"
+	switch state {
+	case libvirt.DOMAIN_PAUSED:
+		desc = "paused"
+	case libvirt.DOMAIN_PMSUSPENDED:
+		desc = "suspended"
+	case libvirt.DOMAIN_CRASHED:
+		desc = "crashed"
+	case libvirt.DOMAIN_SHUTDOWN:
+		desc = "shutting down"
+	}
+
+	return fmt.Errorf("VM '%s' exists but is currently %s. Please shut it down first", vmName, desc)
+}
+
+// getMacAddresses returns the MAC address of every network interface
+// defined on the domain, in document order.
+func getMacAddresses(dom *libvirt.Domain) ([]string, error) {
+	domXML, err := dom.GetXMLDesc(0)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get domain XML: %v", err)
+	}
+
+	var domcfg libvirtxml.Domain
+	if err := xml.Unmarshal([]byte(domXML), &domcfg); err != nil {
+		return nil, fmt.Errorf("Failed to parse domain XML: %v", err)
+	}
+
+	var macAddresses []string
+	for _, iface := range domcfg.Devices.Interfaces {
+		if iface.MAC != nil && iface.MAC.Address != "" {
+			macAddresses = append(macAddresses, iface.MAC.Address)
+		}
+	}
+
+	return macAddresses, nil
+}
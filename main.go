@@ -1,27 +1,13 @@
 package main
 
 import (
-	"bufio"
-	"bytes"
-	"encoding/xml"
 	"flag"
 	"fmt"
 	"os"
-	"os/exec"
-	"strings"
-)
-
-// network interface from virsh XML
-type Interface struct {
-	Mac struct {
-		Address string `xml:"address,attr"`
-	} `xml:"mac"`
-}
+	"regexp"
 
-// virsh domain XML structure
-type Domain struct {
-	Interfaces []Interface `xml:"devices>interface"`
-}
+	libvirt "libvirt.org/go/libvirt"
+)
 
 func main() {
 	// Define command line flags
@@ -31,6 +17,16 @@ func main() {
 	startIndex := flag.Int("start-index", 0, "Starting index for interface numbering")
 	ruleName := flag.String("rule-name", "70-persistent-net.rules", "Filename for the udev rules")
 	verbose := flag.Bool("verbose", false, "Display verbose output")
+	connectURI := flag.String("connect", "qemu:///system", "libvirt connection URI")
+	scheme := flag.String("scheme", "udev", "Naming scheme to generate: udev, systemd-link or both")
+	all := flag.Bool("all", false, "Process every shut-off VM instead of naming them on the command line")
+	match := flag.String("match", "", "Regex filtering the VM names to process")
+	parallelism := flag.Int("parallelism", 1, "Number of VMs to process concurrently")
+	allocation := flag.String("allocation", "gap-fill", "Index allocation for new MACs: gap-fill or append")
+	importFlag := flag.Bool("import", false, "Seed the MAC/name mapping from the VM's existing rules file instead of generating new ones")
+	syncMetadata := flag.Bool("sync-metadata", false, "Mirror the MAC/name mapping into the domain XML as libvirt metadata")
+	outputFormat := flag.String("output-format", "udev", "Output format: udev, netplan, network-manager or cloud-init-v2")
+	seedISO := flag.String("seed-iso", "", "Path to write a NoCloud seed ISO for --output-format cloud-init-v2 and attach it to the VM (a directory when processing more than one VM)")
 
 	flag.Parse()
 
@@ -40,84 +36,95 @@ func main() {
 		return
 	}
 
-	// Check if VM name is provided
 	args := flag.Args()
-	if len(args) != 1 {
-		fmt.Println("Error: VM name is required")
+	if !*all && len(args) == 0 {
+		fmt.Println("Error: at least one VM name is required (or use --all)")
 		displayHelp()
 		os.Exit(1)
 	}
-	vmName := args[0]
 
-	if *verbose {
-		fmt.Printf("Processing VM: %s\n", vmName)
+	var nameFilter *regexp.Regexp
+	if *match != "" {
+		re, err := regexp.Compile(*match)
+		if err != nil {
+			fmt.Printf("Error: invalid --match regex: %v\n", err)
+			os.Exit(1)
+		}
+		nameFilter = re
 	}
 
-	// Check if VM exists and is shut off
-	if err := checkVMStatus(vmName); err != nil {
-		fmt.Println(err)
+	conn, err := libvirt.NewConnect(*connectURI)
+	if err != nil {
+		fmt.Printf("Error: Failed to connect to libvirt at '%s': %v\n", *connectURI, err)
 		os.Exit(1)
 	}
+	defer conn.Close()
 
-	// Get VM XML and extract MAC addresses
-	macAddresses, err := getMacAddresses(vmName)
-	if err != nil {
-		fmt.Printf("Error: Failed to get MAC addresses: %v\n", err)
-		os.Exit(1)
+	vmNames := args
+	if *all {
+		vmNames, err = listShutoffDomains(conn, nameFilter)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	} else if nameFilter != nil {
+		filtered := make([]string, 0, len(vmNames))
+		for _, name := range vmNames {
+			if nameFilter.MatchString(name) {
+				filtered = append(filtered, name)
+			}
+		}
+		vmNames = filtered
 	}
 
-	if len(macAddresses) == 0 {
-		fmt.Println("Warning: No network interfaces found in the VM")
+	if len(vmNames) == 0 {
+		fmt.Println("Warning: no VMs matched")
 		os.Exit(1)
 	}
 
-	if *verbose {
-		fmt.Printf("Found %d network interfaces\n", len(macAddresses))
+	opts := Options{
+		Prefix:       *prefix,
+		StartIndex:   *startIndex,
+		RuleName:     *ruleName,
+		Scheme:       *scheme,
+		Allocation:   *allocation,
+		DryRun:       *dryRun,
+		Verbose:      *verbose,
+		ShowContent:  len(vmNames) == 1,
+		Import:       *importFlag,
+		SyncMetadata: *syncMetadata,
+		OutputFormat: *outputFormat,
+		SeedISO:      *seedISO,
+		MultiVM:      len(vmNames) > 1,
 	}
 
-	// Generate udev rules file
-	rulesFile, err := generateRulesFile(macAddresses, vmName, *prefix, *startIndex, *ruleName)
-	if err != nil {
-		fmt.Printf("Error: Failed to generate rules file: %v\n", err)
-		os.Exit(1)
-	}
-
-	// Display rules file content
-	rulesContent, err := os.ReadFile(rulesFile)
-	if err != nil {
-		fmt.Printf("Error: Failed to read generated rules file: %v\n", err)
-		os.Exit(1)
+	if *verbose {
+		fmt.Printf("Processing %d VM(s) with parallelism %d\n", len(vmNames), *parallelism)
 	}
 
-	fmt.Println("Generated udev rules:")
-	fmt.Println("----------------------------------------")
-	fmt.Println(string(rulesContent))
-	fmt.Println("----------------------------------------")
+	results := runBatch(conn, vmNames, *parallelism, opts)
+	printSummary(results)
 
-	// If dry-run, exit here
-	if *dryRun {
-		fmt.Println("Dry run completed. Rules file not copied to VM.")
-		os.Remove(rulesFile)
-		return
+	failed := 0
+	for _, r := range results {
+		if r.Status == "error" {
+			failed++
+		}
 	}
-
-	// Copy rules file to VM
-	if err := copyRulesToVM(rulesFile, vmName, *ruleName); err != nil {
-		fmt.Printf("Error: Failed to copy rules to VM: %v\n", err)
-		os.Remove(rulesFile)
+	if failed > 0 {
 		os.Exit(1)
 	}
 
-	// Clean up and display completion message
-	os.Remove(rulesFile)
-	fmt.Printf("Successfully configured network interfaces for VM '%s'\n", vmName)
-	fmt.Printf("Start the VM with: sudo virsh start %s\n", vmName)
+	if !*dryRun {
+		fmt.Println("\nStart the VMs with: sudo virsh start <vm-name>")
+	}
 }
 
 func displayHelp() {
 	fmt.Println("kvm-vm-persistent-net - Set persistent network interface names for KVM VMs")
 	fmt.Println("\nUsage:")
-	fmt.Println("  kvm-vm-persistent-net [flags] <vm-name>")
+	fmt.Println("  kvm-vm-persistent-net [flags] <vm-name> [<vm-name>...]")
+	fmt.Println("  kvm-vm-persistent-net [flags] --all")
 	fmt.Println("\nFlags:")
 	flag.PrintDefaults()
 	fmt.Println("\nExamples:")
@@ -125,100 +132,12 @@ func displayHelp() {
 	fmt.Println("  kvm-vm-persistent-net --prefix enp centos7-vm")
 	fmt.Println("  kvm-vm-persistent-net --start-index 1 ubuntu-vm")
 	fmt.Println("  kvm-vm-persistent-net --dry-run debian-vm")
-}
-
-func checkVMStatus(vmName string) error {
-	// Check if VM exists and is shut off
-	cmd := exec.Command("sudo", "virsh", "list", "--state-shutoff", "--name")
-	output, err := cmd.Output()
-	if err != nil {
-		return fmt.Errorf("Failed to execute virsh command: %v", err)
-	}
-
-	// Check if VM is in the list of shut-off VMs
-	scanner := bufio.NewScanner(bytes.NewReader(output))
-	for scanner.Scan() {
-		if strings.TrimSpace(scanner.Text()) == vmName {
-			return nil
-		}
-	}
-
-	// VM not found in shut-off list, check if it exists at all
-	cmd = exec.Command("sudo", "virsh", "list", "--all", "--name")
-	output, err = cmd.Output()
-	if err != nil {
-		return fmt.Errorf("Failed to execute virsh command: %v", err)
-	}
-
-	scanner = bufio.NewScanner(bytes.NewReader(output))
-	for scanner.Scan() {
-		if strings.TrimSpace(scanner.Text()) == vmName {
-			return fmt.Errorf("VM '%s' exists but is currently running. Please shut it down first", vmName)
-		}
-	}
-
-	return fmt.Errorf("VM '%s' does not exist", vmName)
-}
-
-func getMacAddresses(vmName string) ([]string, error) {
-	// Get VM XML using virsh dumpxml
-	cmd := exec.Command("sudo", "virsh", "dumpxml", vmName)
-	output, err := cmd.Output()
-	if err != nil {
-		return nil, fmt.Errorf("Failed to execute virsh dumpxml: %v", err)
-	}
-
-	// Parse XML to extract MAC addresses
-	var domain Domain
-	if err := xml.Unmarshal(output, &domain); err != nil {
-		return nil, fmt.Errorf("Failed to parse XML: %v", err)
-	}
-
-	// Extract MAC addresses
-	var macAddresses []string
-	for _, iface := range domain.Interfaces {
-		if iface.Mac.Address != "" {
-			macAddresses = append(macAddresses, iface.Mac.Address)
-		}
-	}
-
-	return macAddresses, nil
-}
-
-func generateRulesFile(macAddresses []string, vmName, prefix string, startIndex int, ruleName string) (string, error) {
-	// Create rules file in the current directory
-	filePath := ruleName
-	file, err := os.Create(filePath)
-	if err != nil {
-		return "", fmt.Errorf("Failed to create rules file: %v", err)
-	}
-	defer file.Close()
-
-	// Write rules to file
-	writer := bufio.NewWriter(file)
-	fmt.Fprintf(writer, "# Network interface persistence rules for VM '%s'\n", vmName)
-
-	for i, mac := range macAddresses {
-		interfaceName := fmt.Sprintf("%s%d", prefix, startIndex+i)
-		fmt.Fprintf(writer, "SUBSYSTEM==\"net\", ACTION==\"add\", ATTR{address}==\"%s\", NAME=\"%s\"\n", mac, interfaceName)
-	}
-
-	writer.Flush()
-	return filePath, nil
-}
-
-func copyRulesToVM(rulesFile, vmName, ruleName string) error {
-	// Use virt-copy-in to copy the file to the VM
-	cmd := exec.Command("sudo", "virt-copy-in", "-d", vmName, rulesFile, "/etc/udev/rules.d/")
-
-	// Capture both stdout and stderr
-	var stdoutErr bytes.Buffer
-	cmd.Stdout = &stdoutErr
-	cmd.Stderr = &stdoutErr
-
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("Failed to copy rules file to VM: %v\nOutput: %s", err, stdoutErr.String())
-	}
-
-	return nil
+	fmt.Println("  kvm-vm-persistent-net --connect qemu+ssh://user@host/system remote-vm")
+	fmt.Println("  kvm-vm-persistent-net --scheme systemd-link ubuntu-vm")
+	fmt.Println("  kvm-vm-persistent-net --scheme both rocky-vm")
+	fmt.Println("  kvm-vm-persistent-net --all --match '^web-' --parallelism 4")
+	fmt.Println("  kvm-vm-persistent-net --import centos7-vm")
+	fmt.Println("  kvm-vm-persistent-net --allocation append --sync-metadata ubuntu-vm")
+	fmt.Println("  kvm-vm-persistent-net --output-format netplan ubuntu-cloud-vm")
+	fmt.Println("  kvm-vm-persistent-net --output-format cloud-init-v2 --seed-iso /var/lib/libvirt/images/vm-seed.iso vm")
 }
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	libvirt "libvirt.org/go/libvirt"
+)
+
+const (
+	metadataNamespaceURI = "https://github.com/zinrai/kvm-vm-persistent-net"
+	metadataKey          = "kvmnet"
+)
+
+// syncStateToMetadata mirrors state's MAC -> name mapping into the domain's
+// persistent XML as a per-app <metadata> element, so it travels with the
+// VM even if the local state file is lost.
+func syncStateToMetadata(dom *libvirt.Domain, state *VMState) error {
+	macs := make([]string, 0, len(state.Mappings))
+	for mac := range state.Mappings {
+		macs = append(macs, mac)
+	}
+	sort.Strings(macs)
+
+	var buf bytes.Buffer
+	buf.WriteString("<kvmnet:interfaces>\n")
+	for _, mac := range macs {
+		fmt.Fprintf(&buf, "  <kvmnet:interface mac=%q name=%q/>\n", mac, state.Mappings[mac])
+	}
+	buf.WriteString("</kvmnet:interfaces>")
+
+	return dom.SetMetadata(
+		libvirt.DOMAIN_METADATA_ELEMENT,
+		buf.String(),
+		metadataKey,
+		metadataNamespaceURI,
+		libvirt.DOMAIN_AFFECT_CONFIG,
+	)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"os/exec"
+	"strings"
+)
+
+// osRelease holds the fields of /etc/os-release we care about.
+type osRelease struct {
+	ID     string
+	IDLike string
+}
+
+// detectOSFamily reads /etc/os-release from the guest disk via virt-cat.
+// It returns a zero-value osRelease (no error) if the file can't be read,
+// since this is only used for an advisory warning.
+func detectOSFamily(vmName string) osRelease {
+	cmd := exec.Command("virt-cat", "-d", vmName, "/etc/os-release")
+	output, err := cmd.Output()
+	if err != nil {
+		return osRelease{}
+	}
+
+	var rel osRelease
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "ID="):
+			rel.ID = unquote(strings.TrimPrefix(line, "ID="))
+		case strings.HasPrefix(line, "ID_LIKE="):
+			rel.IDLike = unquote(strings.TrimPrefix(line, "ID_LIKE="))
+		}
+	}
+
+	return rel
+}
+
+func unquote(s string) string {
+	return strings.Trim(s, `"`)
+}
+
+// schemeWarning returns a non-empty advisory message when scheme is unlikely
+// to take effect on the detected guest OS family, or "" otherwise.
+func schemeWarning(scheme string, rel osRelease) string {
+	if rel.ID == "" {
+		return ""
+	}
+
+	modern := map[string]bool{
+		"rhel": true, "centos": true, "fedora": true, "rocky": true, "almalinux": true,
+		"ubuntu": true, "debian": true,
+	}
+
+	isModern := modern[rel.ID]
+	if !isModern {
+		for _, like := range strings.Fields(rel.IDLike) {
+			if modern[like] {
+				isModern = true
+				break
+			}
+		}
+	}
+
+	switch scheme {
+	case "udev":
+		if isModern {
+			return "Warning: '" + rel.ID + "' uses systemd-networkd's net_setup_link builtin, which may ignore " +
+				"udev NAME= rules. Consider --scheme systemd-link or --scheme both."
+		}
+	case "systemd-link":
+		if !isModern {
+			return "Warning: '" + rel.ID + "' may not honour /etc/systemd/network/*.link files. " +
+				"Consider --scheme udev or --scheme both."
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// netplanFile builds a single Netplan v2 config assigning set-name per MAC.
+func netplanFile(macAddresses []string, names map[string]string) GeneratedFile {
+	var buf bytes.Buffer
+	buf.WriteString("network:\n")
+	writeEthernetsYAML(&buf, "  ", macAddresses, names)
+
+	return GeneratedFile{
+		Name:      "99-kvm-vm-persistent-net.yaml",
+		Content:   buf.String(),
+		RemoteDir: "/etc/netplan/",
+	}
+}
+
+// cloudInitNetworkConfigYAML builds a cloud-init network-config v2 document
+// (the same "ethernets:" schema as Netplan, without the "network:" wrapper
+// key that the on-disk Netplan file needs).
+func cloudInitNetworkConfigYAML(macAddresses []string, names map[string]string) string {
+	var buf bytes.Buffer
+	writeEthernetsYAML(&buf, "", macAddresses, names)
+	return buf.String()
+}
+
+func writeEthernetsYAML(buf *bytes.Buffer, indent string, macAddresses []string, names map[string]string) {
+	fmt.Fprintf(buf, "%sversion: 2\n", indent)
+	fmt.Fprintf(buf, "%sethernets:\n", indent)
+	for _, mac := range macAddresses {
+		name := names[mac]
+		fmt.Fprintf(buf, "%s  %s:\n", indent, name)
+		fmt.Fprintf(buf, "%s    match:\n", indent)
+		fmt.Fprintf(buf, "%s      macaddress: \"%s\"\n", indent, mac)
+		fmt.Fprintf(buf, "%s    set-name: %s\n", indent, name)
+	}
+}
+
+// networkManagerFiles builds one NetworkManager keyfile connection profile
+// per MAC.
+func networkManagerFiles(macAddresses []string, names map[string]string) []GeneratedFile {
+	files := make([]GeneratedFile, 0, len(macAddresses))
+
+	for _, mac := range macAddresses {
+		name := names[mac]
+		var buf bytes.Buffer
+		fmt.Fprintf(&buf, "[connection]\nid=%s\ntype=ethernet\ninterface-name=%s\n\n[ethernet]\nmac-address=%s\n", name, name, mac)
+
+		files = append(files, GeneratedFile{
+			Name:      name + ".nmconnection",
+			Content:   buf.String(),
+			RemoteDir: "/etc/NetworkManager/system-connections/",
+		})
+	}
+
+	return files
+}
+
+// buildOutputFiles dispatches to the file builder for outputFormat
+// ("udev", "netplan", "network-manager"; "cloud-init-v2" is handled
+// separately since it produces a seed ISO rather than in-guest files).
+func buildOutputFiles(macAddresses []string, vmName, prefix string, names map[string]string, ruleName, scheme, outputFormat string) ([]GeneratedFile, error) {
+	ordered := sortedMacs(macAddresses, names, prefix)
+
+	switch outputFormat {
+	case "udev":
+		return generateRuleFiles(macAddresses, vmName, prefix, names, ruleName, scheme)
+	case "netplan":
+		return []GeneratedFile{netplanFile(ordered, names)}, nil
+	case "network-manager":
+		return networkManagerFiles(ordered, names), nil
+	default:
+		return nil, fmt.Errorf("unknown output format '%s' (expected udev, netplan, network-manager or cloud-init-v2)", outputFormat)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	libvirt "libvirt.org/go/libvirt"
+)
+
+// processVM configures persistent interface names for a single VM and
+// returns a VMResult summarizing what happened.
+func processVM(conn *libvirt.Connect, vmName string, opts Options) VMResult {
+	result := VMResult{Name: vmName}
+
+	dom, err := conn.LookupDomainByName(vmName)
+	if err != nil {
+		result.Status = "error"
+		result.Err = fmt.Errorf("VM '%s' does not exist", vmName)
+		return result
+	}
+	defer dom.Free()
+
+	if err := checkVMStatus(dom, vmName); err != nil {
+		result.Status = "error"
+		result.Err = err
+		return result
+	}
+
+	state, err := loadState(vmName)
+	if err != nil {
+		result.Status = "error"
+		result.Err = err
+		return result
+	}
+
+	if opts.Import {
+		learned, err := importFromGuestRules(vmName, opts.RuleName, state)
+		if err != nil {
+			result.Status = "error"
+			result.Err = err
+			return result
+		}
+		if err := saveState(state); err != nil {
+			result.Status = "error"
+			result.Err = err
+			return result
+		}
+		result.NumIfaces = learned
+		result.Status = "imported"
+		return result
+	}
+
+	macAddresses, err := getMacAddresses(dom)
+	if err != nil {
+		result.Status = "error"
+		result.Err = fmt.Errorf("Failed to get MAC addresses: %v", err)
+		return result
+	}
+	result.NumIfaces = len(macAddresses)
+
+	if len(macAddresses) == 0 {
+		result.Status = "error"
+		result.Err = fmt.Errorf("No network interfaces found")
+		return result
+	}
+
+	if opts.Verbose {
+		fmt.Printf("[%s] Found %d network interfaces\n", vmName, len(macAddresses))
+	}
+
+	if opts.OutputFormat == "udev" {
+		if warning := schemeWarning(opts.Scheme, detectOSFamily(vmName)); warning != "" {
+			fmt.Printf("[%s] %s\n", vmName, warning)
+		}
+	}
+
+	names := allocateInterfaceNames(macAddresses, state, opts.Prefix, opts.StartIndex, opts.Allocation)
+
+	if opts.OutputFormat == "cloud-init-v2" {
+		return processCloudInitV2(dom, vmName, macAddresses, names, state, opts)
+	}
+
+	files, err := buildOutputFiles(macAddresses, vmName, opts.Prefix, names, opts.RuleName, opts.Scheme, opts.OutputFormat)
+	if err != nil {
+		result.Status = "error"
+		result.Err = fmt.Errorf("Failed to generate rules: %v", err)
+		return result
+	}
+
+	localPaths := make([]string, 0, len(files))
+	defer func() {
+		for _, path := range localPaths {
+			os.Remove(path)
+		}
+	}()
+
+	for _, f := range files {
+		path, err := writeLocalFile(f)
+		if err != nil {
+			result.Status = "error"
+			result.Err = err
+			return result
+		}
+		localPaths = append(localPaths, path)
+
+		if opts.ShowContent {
+			fmt.Printf("Generated %s (-> %s):\n", f.Name, f.RemoteDir)
+			fmt.Println("----------------------------------------")
+			fmt.Println(f.Content)
+			fmt.Println("----------------------------------------")
+		} else if opts.Verbose {
+			fmt.Printf("[%s] Generated %s (-> %s)\n", vmName, f.Name, f.RemoteDir)
+		}
+	}
+
+	if opts.DryRun {
+		result.Status = "dry-run"
+		return result
+	}
+
+	for i, f := range files {
+		if err := copyFileToVM(localPaths[i], vmName, f.RemoteDir); err != nil {
+			result.Status = "error"
+			result.Err = fmt.Errorf("Failed to copy files to VM: %v", err)
+			return result
+		}
+	}
+
+	if err := saveState(state); err != nil {
+		result.Status = "error"
+		result.Err = fmt.Errorf("Failed to save MAC/name mapping: %v", err)
+		return result
+	}
+
+	if opts.SyncMetadata {
+		if err := syncStateToMetadata(dom, state); err != nil {
+			result.Status = "error"
+			result.Err = fmt.Errorf("Failed to sync mapping into domain metadata: %v", err)
+			return result
+		}
+	}
+
+	result.Status = "ok"
+	return result
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// GeneratedFile is a single rules/config file produced for a naming scheme,
+// along with the directory it must be placed in inside the guest.
+type GeneratedFile struct {
+	Name      string
+	Content   string
+	RemoteDir string
+}
+
+// generateRuleFiles builds the set of files needed to implement scheme
+// ("udev", "systemd-link" or "both") for the given MAC -> interface name
+// mapping.
+func generateRuleFiles(macAddresses []string, vmName, prefix string, names map[string]string, ruleName, scheme string) ([]GeneratedFile, error) {
+	ordered := sortedMacs(macAddresses, names, prefix)
+
+	var files []GeneratedFile
+
+	switch scheme {
+	case "udev":
+		files = append(files, udevRulesFile(ordered, names, vmName, ruleName))
+	case "systemd-link":
+		files = append(files, systemdLinkFiles(ordered, names)...)
+	case "both":
+		files = append(files, udevRulesFile(ordered, names, vmName, ruleName))
+		files = append(files, systemdLinkFiles(ordered, names)...)
+	default:
+		return nil, fmt.Errorf("unknown scheme '%s' (expected udev, systemd-link or both)", scheme)
+	}
+
+	return files, nil
+}
+
+func udevRulesFile(macAddresses []string, names map[string]string, vmName, ruleName string) GeneratedFile {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# Network interface persistence rules for VM '%s'\n", vmName)
+
+	for _, mac := range macAddresses {
+		fmt.Fprintf(&buf, "SUBSYSTEM==\"net\", ACTION==\"add\", ATTR{address}==\"%s\", NAME=\"%s\"\n", mac, names[mac])
+	}
+
+	return GeneratedFile{
+		Name:      ruleName,
+		Content:   buf.String(),
+		RemoteDir: "/etc/udev/rules.d/",
+	}
+}
+
+func systemdLinkFiles(macAddresses []string, names map[string]string) []GeneratedFile {
+	files := make([]GeneratedFile, 0, len(macAddresses))
+
+	for _, mac := range macAddresses {
+		interfaceName := names[mac]
+		var buf bytes.Buffer
+		fmt.Fprintf(&buf, "[Match]\nMACAddress=%s\n\n[Link]\nName=%s\n", mac, interfaceName)
+
+		files = append(files, GeneratedFile{
+			Name:      fmt.Sprintf("10-%s.link", interfaceName),
+			Content:   buf.String(),
+			RemoteDir: "/etc/systemd/network/",
+		})
+	}
+
+	return files
+}
+
+// writeLocalFile writes a GeneratedFile to the current directory and returns
+// the local path it was written to.
+func writeLocalFile(f GeneratedFile) (string, error) {
+	file, err := os.Create(f.Name)
+	if err != nil {
+		return "", fmt.Errorf("Failed to create file '%s': %v", f.Name, err)
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	if _, err := writer.WriteString(f.Content); err != nil {
+		return "", fmt.Errorf("Failed to write file '%s': %v", f.Name, err)
+	}
+
+	return f.Name, writer.Flush()
+}
+
+func copyFileToVM(localPath, vmName, remoteDir string) error {
+	// Use virt-copy-in to copy the file to the VM
+	cmd := exec.Command("virt-copy-in", "-d", vmName, localPath, remoteDir)
+
+	// Capture both stdout and stderr
+	var stdoutErr bytes.Buffer
+	cmd.Stdout = &stdoutErr
+	cmd.Stderr = &stdoutErr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("Failed to copy '%s' to VM: %v\nOutput: %s", localPath, err, stdoutErr.String())
+	}
+
+	return nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	libvirt "libvirt.org/go/libvirt"
+	libvirtxml "libvirt.org/go/libvirtxml"
+)
+
+// seedDiskAlias marks the cdrom device we attach, so a later run can find
+// and update it instead of attaching a duplicate at a clashing target.
+const seedDiskAlias = "ua-kvmnet-seed"
+
+// buildSeedISO writes a NoCloud seed (meta-data, network-config, user-data)
+// and packs it into a cidata ISO at isoPath.
+func buildSeedISO(vmName, isoPath, networkConfigYAML string) error {
+	tmpDir, err := os.MkdirTemp("", "kvmnet-seed-")
+	if err != nil {
+		return fmt.Errorf("Failed to create temp seed directory: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	metaData := fmt.Sprintf("instance-id: %s\nlocal-hostname: %s\n", vmName, vmName)
+	seedFiles := map[string]string{
+		"meta-data":      metaData,
+		"network-config": networkConfigYAML,
+		"user-data":      "#cloud-config\n{}\n",
+	}
+
+	for name, content := range seedFiles {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0o644); err != nil {
+			return fmt.Errorf("Failed to write seed file '%s': %v", name, err)
+		}
+	}
+
+	isoTool := "genisoimage"
+	if _, err := exec.LookPath(isoTool); err != nil {
+		isoTool = "mkisofs"
+	}
+
+	cmd := exec.Command(isoTool, "-output", isoPath, "-volid", "cidata", "-joliet", "-rock",
+		filepath.Join(tmpDir, "meta-data"),
+		filepath.Join(tmpDir, "network-config"),
+		filepath.Join(tmpDir, "user-data"),
+	)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("Failed to build seed ISO with %s: %v\nOutput: %s", isoTool, err, output)
+	}
+
+	return nil
+}
+
+// attachSeedISO attaches isoPath to dom as a read-only cdrom, persisted in
+// the domain's offline config. If a seed cdrom from a previous run is
+// already present, its source is updated in place rather than attaching a
+// second device at a clashing target.
+func attachSeedISO(dom *libvirt.Domain, isoPath string) error {
+	domXML, err := dom.GetXMLDesc(0)
+	if err != nil {
+		return fmt.Errorf("Failed to get domain XML: %v", err)
+	}
+
+	var domcfg libvirtxml.Domain
+	if err := xml.Unmarshal([]byte(domXML), &domcfg); err != nil {
+		return fmt.Errorf("Failed to parse domain XML: %v", err)
+	}
+
+	if target := existingSeedDiskTarget(domcfg.Devices.Disks); target != "" {
+		diskXML := seedDiskXML(isoPath, target)
+		return dom.UpdateDeviceFlags(diskXML, libvirt.DOMAIN_DEVICE_MODIFY_CONFIG)
+	}
+
+	diskXML := seedDiskXML(isoPath, freeDiskTarget(domcfg.Devices.Disks))
+	return dom.AttachDeviceFlags(diskXML, libvirt.DOMAIN_DEVICE_MODIFY_CONFIG)
+}
+
+// existingSeedDiskTarget returns the target dev of a previously-attached
+// seed disk (identified by seedDiskAlias), or "" if none is present.
+func existingSeedDiskTarget(disks []libvirtxml.DomainDisk) string {
+	for _, disk := range disks {
+		if disk.Alias != nil && disk.Alias.Name == seedDiskAlias && disk.Target != nil {
+			return disk.Target.Dev
+		}
+	}
+	return ""
+}
+
+// freeDiskTarget picks a "sd*" target not already used by an existing disk.
+func freeDiskTarget(disks []libvirtxml.DomainDisk) string {
+	used := make(map[string]bool, len(disks))
+	for _, disk := range disks {
+		if disk.Target != nil {
+			used[disk.Target.Dev] = true
+		}
+	}
+
+	for c := 'z'; c >= 'a'; c-- {
+		dev := "sd" + string(c)
+		if !used[dev] {
+			return dev
+		}
+	}
+
+	// Exhausting the single-letter sd* range never happens in practice.
+	return "sdz"
+}
+
+func seedDiskXML(isoPath, target string) string {
+	return fmt.Sprintf(`<disk type='file' device='cdrom'>
+  <driver name='qemu' type='raw'/>
+  <source file='%s'/>
+  <target dev='%s' bus='sata'/>
+  <alias name='%s'/>
+  <readonly/>
+</disk>`, isoPath, target, seedDiskAlias)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// VMState is the persisted MAC -> interface name mapping for a single VM.
+type VMState struct {
+	VMName   string            `json:"vm_name"`
+	Mappings map[string]string `json:"mappings"`
+}
+
+// stateFilePath returns the default path of the state file for vmName,
+// creating its parent directory if necessary.
+func stateFilePath(vmName string) (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("Failed to resolve home directory: %v", err)
+	}
+
+	dir := filepath.Join(home, ".config", "kvm-vm-persistent-net")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("Failed to create state directory '%s': %v", dir, err)
+	}
+
+	return filepath.Join(dir, vmName+".json"), nil
+}
+
+// loadState reads the state file for vmName, returning an empty state
+// (not an error) if none exists yet.
+func loadState(vmName string) (*VMState, error) {
+	path, err := stateFilePath(vmName)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &VMState{VMName: vmName, Mappings: map[string]string{}}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read state file '%s': %v", path, err)
+	}
+
+	var state VMState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("Failed to parse state file '%s': %v", path, err)
+	}
+	if state.Mappings == nil {
+		state.Mappings = map[string]string{}
+	}
+
+	return &state, nil
+}
+
+// saveState writes state back to its default location, pretty-printed.
+func saveState(state *VMState) error {
+	path, err := stateFilePath(state.VMName)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("Failed to encode state: %v", err)
+	}
+
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("Failed to write state file '%s': %v", path, err)
+	}
+
+	return nil
+}
+
+// allocateInterfaceNames returns the mac -> interface name mapping to use
+// for macAddresses. MACs already present in state keep their assigned
+// name; new MACs get a freshly allocated index per the allocation
+// strategy ("gap-fill" or "append"), and state is updated in place.
+func allocateInterfaceNames(macAddresses []string, state *VMState, prefix string, startIndex int, allocation string) map[string]string {
+	used := usedIndices(state.Mappings, prefix)
+	names := make(map[string]string, len(macAddresses))
+
+	for _, mac := range macAddresses {
+		if name, ok := state.Mappings[mac]; ok {
+			names[mac] = name
+			continue
+		}
+
+		idx := nextIndex(used, startIndex, allocation)
+		name := fmt.Sprintf("%s%d", prefix, idx)
+		state.Mappings[mac] = name
+		names[mac] = name
+		used[idx] = true
+	}
+
+	return names
+}
+
+// usedIndices returns the set of prefix-relative indices already assigned
+// in mappings.
+func usedIndices(mappings map[string]string, prefix string) map[int]bool {
+	used := make(map[int]bool, len(mappings))
+	for _, name := range mappings {
+		if idx, ok := parseIndex(name, prefix); ok {
+			used[idx] = true
+		}
+	}
+	return used
+}
+
+func parseIndex(name, prefix string) (int, bool) {
+	if !strings.HasPrefix(name, prefix) {
+		return 0, false
+	}
+	idx, err := strconv.Atoi(strings.TrimPrefix(name, prefix))
+	if err != nil {
+		return 0, false
+	}
+	return idx, true
+}
+
+// nextIndex picks the index for a newly-seen MAC given the already-used
+// indices and the allocation strategy.
+func nextIndex(used map[int]bool, startIndex int, allocation string) int {
+	if allocation == "append" {
+		next := startIndex
+		for idx := range used {
+			if idx >= next {
+				next = idx + 1
+			}
+		}
+		return next
+	}
+
+	// gap-fill: take the lowest free index at or above startIndex
+	for idx := startIndex; ; idx++ {
+		if !used[idx] {
+			return idx
+		}
+	}
+}
+
+// sortedMacs returns macAddresses ordered by their assigned index, for
+// stable, human-readable rule file output.
+func sortedMacs(macAddresses []string, names map[string]string, prefix string) []string {
+	sorted := append([]string(nil), macAddresses...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		idxI, _ := parseIndex(names[sorted[i]], prefix)
+		idxJ, _ := parseIndex(names[sorted[j]], prefix)
+		return idxI < idxJ
+	})
+	return sorted
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseIndex(t *testing.T) {
+	cases := []struct {
+		name    string
+		prefix  string
+		wantIdx int
+		wantOK  bool
+	}{
+		{"eth0", "eth", 0, true},
+		{"eth12", "eth", 12, true},
+		{"enp3", "eth", 0, false},
+		{"eth", "eth", 0, false},
+		{"ethx", "eth", 0, false},
+	}
+
+	for _, c := range cases {
+		idx, ok := parseIndex(c.name, c.prefix)
+		if ok != c.wantOK || (ok && idx != c.wantIdx) {
+			t.Errorf("parseIndex(%q, %q) = (%d, %v), want (%d, %v)", c.name, c.prefix, idx, ok, c.wantIdx, c.wantOK)
+		}
+	}
+}
+
+func TestNextIndexGapFill(t *testing.T) {
+	used := map[int]bool{0: true, 1: true, 3: true}
+
+	if idx := nextIndex(used, 0, "gap-fill"); idx != 2 {
+		t.Errorf("expected gap-fill to reuse the hole at 2, got %d", idx)
+	}
+}
+
+func TestNextIndexGapFillRespectsStartIndex(t *testing.T) {
+	used := map[int]bool{0: true}
+
+	if idx := nextIndex(used, 1, "gap-fill"); idx != 1 {
+		t.Errorf("expected gap-fill to honor start-index, got %d", idx)
+	}
+}
+
+func TestNextIndexAppend(t *testing.T) {
+	used := map[int]bool{0: true, 1: true, 3: true}
+
+	if idx := nextIndex(used, 0, "append"); idx != 4 {
+		t.Errorf("expected append to continue after the highest used index, got %d", idx)
+	}
+}
+
+func TestNextIndexAppendEmpty(t *testing.T) {
+	used := map[int]bool{}
+
+	if idx := nextIndex(used, 2, "append"); idx != 2 {
+		t.Errorf("expected append with no prior mappings to start at start-index, got %d", idx)
+	}
+}
+
+func TestAllocateInterfaceNamesKeepsExistingMacs(t *testing.T) {
+	state := &VMState{
+		VMName: "vm1",
+		Mappings: map[string]string{
+			"aa:bb:cc:dd:ee:01": "eth0",
+			"aa:bb:cc:dd:ee:02": "eth1",
+		},
+	}
+
+	macs := []string{"aa:bb:cc:dd:ee:01", "aa:bb:cc:dd:ee:02", "aa:bb:cc:dd:ee:03"}
+	names := allocateInterfaceNames(macs, state, "eth", 0, "gap-fill")
+
+	want := map[string]string{
+		"aa:bb:cc:dd:ee:01": "eth0",
+		"aa:bb:cc:dd:ee:02": "eth1",
+		"aa:bb:cc:dd:ee:03": "eth2",
+	}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("allocateInterfaceNames = %v, want %v", names, want)
+	}
+	if !reflect.DeepEqual(state.Mappings, want) {
+		t.Errorf("state.Mappings not updated in place: got %v, want %v", state.Mappings, want)
+	}
+}
+
+func TestAllocateInterfaceNamesFillsGapAfterNicRemoval(t *testing.T) {
+	// eth1's MAC is gone (NIC removed); a new NIC should reuse the gap at 1
+	// under gap-fill rather than renumbering eth0 or eth2.
+	state := &VMState{
+		VMName: "vm1",
+		Mappings: map[string]string{
+			"aa:bb:cc:dd:ee:01": "eth0",
+			"aa:bb:cc:dd:ee:03": "eth2",
+		},
+	}
+
+	macs := []string{"aa:bb:cc:dd:ee:01", "aa:bb:cc:dd:ee:03", "aa:bb:cc:dd:ee:04"}
+	names := allocateInterfaceNames(macs, state, "eth", 0, "gap-fill")
+
+	if names["aa:bb:cc:dd:ee:01"] != "eth0" {
+		t.Errorf("expected existing MAC to keep eth0, got %s", names["aa:bb:cc:dd:ee:01"])
+	}
+	if names["aa:bb:cc:dd:ee:03"] != "eth2" {
+		t.Errorf("expected existing MAC to keep eth2, got %s", names["aa:bb:cc:dd:ee:03"])
+	}
+	if names["aa:bb:cc:dd:ee:04"] != "eth1" {
+		t.Errorf("expected new MAC to fill the gap at eth1, got %s", names["aa:bb:cc:dd:ee:04"])
+	}
+}
+
+func TestAllocateInterfaceNamesAppend(t *testing.T) {
+	state := &VMState{
+		VMName: "vm1",
+		Mappings: map[string]string{
+			"aa:bb:cc:dd:ee:01": "eth0",
+			"aa:bb:cc:dd:ee:03": "eth2",
+		},
+	}
+
+	macs := []string{"aa:bb:cc:dd:ee:01", "aa:bb:cc:dd:ee:03", "aa:bb:cc:dd:ee:04"}
+	names := allocateInterfaceNames(macs, state, "eth", 0, "append")
+
+	if names["aa:bb:cc:dd:ee:04"] != "eth3" {
+		t.Errorf("expected append to continue after the highest index, got %s", names["aa:bb:cc:dd:ee:04"])
+	}
+}
+
+func TestSortedMacs(t *testing.T) {
+	macs := []string{"mac-for-eth2", "mac-for-eth0", "mac-for-eth1"}
+	names := map[string]string{
+		"mac-for-eth2": "eth2",
+		"mac-for-eth0": "eth0",
+		"mac-for-eth1": "eth1",
+	}
+
+	got := sortedMacs(macs, names, "eth")
+	want := []string{"mac-for-eth0", "mac-for-eth1", "mac-for-eth2"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("sortedMacs = %v, want %v", got, want)
+	}
+}